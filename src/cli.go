@@ -0,0 +1,472 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// Exit codes returned by main, following the convention used throughout the
+// 'ub' tool: 0 for success, 1 when a readiness/ensure check failed, 2 for a
+// usage error (bad flags, missing arguments, unknown subcommand) and for any
+// other error a command returns.
+const (
+	exitSuccess     = 0
+	exitCheckFailed = 1
+	exitUsageError  = 2
+)
+
+//errCheckFailed is returned by a command's Execute when the check it performs
+//(eg a readiness probe or an "ensure" assertion) came back negative rather
+//than erroring out. main translates it to exitCheckFailed.
+var errCheckFailed = errors.New("check failed")
+
+//options holds the flags accepted before the subcommand name, eg 'ub -v kafka-ready ...'.
+type options struct {
+	Verbose bool `short:"v" long:"verbose" description:"Enable verbose (debug) logging"`
+}
+
+//tlsFlags are the mTLS flags shared by all the '*-ready' commands.
+type tlsFlags struct {
+	ClientCert string `long:"client-cert" description:"Path to a PEM client certificate used for mutual TLS"`
+	ClientKey  string `long:"client-key" description:"Path to the PEM private key matching --client-cert"`
+	CACert     string `long:"ca-cert" description:"Path to a PEM CA bundle used to verify the server certificate"`
+	ServerName string `long:"server-name" description:"Override the server name used for TLS SNI and certificate verification"`
+}
+
+//oauthFlags are the SASL/OAUTHBEARER flags shared by all the '*-ready' commands.
+type oauthFlags struct {
+	TokenURL     string `long:"oauth-token-url" description:"Token endpoint used to fetch an access token via the OAuth2 client-credentials grant"`
+	ClientID     string `long:"oauth-client-id" env:"UB_OAUTH_CLIENT_ID" description:"OAuth client id"`
+	ClientSecret string `long:"oauth-client-secret" env:"UB_OAUTH_CLIENT_SECRET" description:"OAuth client secret"`
+}
+
+//httpReadyArgs are the flags and positional arguments shared by all the
+//'*-ready' commands that poll an HTTP(S) endpoint (sr-ready, kr-ready, ...).
+type httpReadyArgs struct {
+	Secure          bool       `long:"secure" description:"Use TLS to secure the connection"`
+	IgnoreCert      bool       `long:"ignore-cert" description:"Ignore TLS certificate errors"`
+	Username        string     `long:"username" env:"UB_USERNAME" description:"Username used for basic authentication"`
+	Password        string     `long:"password" env:"UB_PASSWORD" description:"Password used for basic authentication"`
+	TLS             tlsFlags   `group:"TLS"`
+	BearerToken     string     `long:"bearer-token" env:"UB_BEARER_TOKEN" description:"Static bearer token sent as an Authorization header"`
+	BearerTokenFile string     `long:"bearer-token-file" description:"Path to a file containing a static bearer token"`
+	OAuth           oauthFlags `group:"OAuth"`
+	Positional      struct {
+		Host    string `positional-arg-name:"host" description:"Host to connect to"`
+		Port    string `positional-arg-name:"port" description:"Port to connect to"`
+		Timeout string `positional-arg-name:"timeout" description:"Timeout in seconds"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+//check runs checkHttp against path with pred, translating a negative result into errCheckFailed.
+func (a *httpReadyArgs) check(path string, pred func(string) bool) error {
+	bearerToken := a.BearerToken
+	if a.BearerTokenFile != "" {
+		data, err := os.ReadFile(a.BearerTokenFile)
+		if err != nil {
+			return err
+		}
+		bearerToken = strings.TrimSpace(string(data))
+	}
+	ok := checkHttp(httpCheckOptions{
+		Host:        a.Positional.Host,
+		Port:        a.Positional.Port,
+		Timeout:     parseSecondsDuration(a.Positional.Timeout),
+		Path:        path,
+		UseHttps:    a.Secure,
+		IgnoreCert:  a.IgnoreCert,
+		Username:    a.Username,
+		Password:    a.Password,
+		TLS:         tlsOptions(a.TLS),
+		BearerToken: bearerToken,
+		OAuth:       oauthOptions(a.OAuth),
+		Pred:        pred,
+	})
+	if !ok {
+		return errCheckFailed
+	}
+	return nil
+}
+
+//Predicates applied to the response body of each HTTP readiness check.
+//Named so they can be reused by the 'serve' command's scheduled probes.
+var (
+	srReadyPred            = func(s string) bool { return strings.Contains(s, "compatibilityLevel") }
+	connectReadyPred       = func(s string) bool { return strings.Contains(s, "version") }
+	ksqlServerReadyPred    = func(s string) bool { return strings.Contains(s, "Ksql") }
+	controlCenterReadyPred = func(s string) bool { return strings.Contains(s, "Control Center") }
+)
+
+type srReadyCommand struct{ httpReadyArgs }
+
+func (c *srReadyCommand) Execute(args []string) error {
+	return c.check("config", srReadyPred)
+}
+
+type krReadyCommand struct{ httpReadyArgs }
+
+func (c *krReadyCommand) Execute(args []string) error {
+	return c.check("topics", nil)
+}
+
+type connectReadyCommand struct{ httpReadyArgs }
+
+func (c *connectReadyCommand) Execute(args []string) error {
+	return c.check("", connectReadyPred)
+}
+
+type ksqlServerReadyCommand struct{ httpReadyArgs }
+
+func (c *ksqlServerReadyCommand) Execute(args []string) error {
+	return c.check("info", ksqlServerReadyPred)
+}
+
+type controlCenterReadyCommand struct{ httpReadyArgs }
+
+func (c *controlCenterReadyCommand) Execute(args []string) error {
+	return c.check("", controlCenterReadyPred)
+}
+
+type ensureCommand struct {
+	Positional struct {
+		EnvVar string `positional-arg-name:"env-var" description:"Environment variable that must be set"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *ensureCommand) Execute(args []string) error {
+	if !ensure(c.Positional.EnvVar) {
+		return errCheckFailed
+	}
+	return nil
+}
+
+type ensureAtLeastOneCommand struct {
+	Positional struct {
+		EnvVars []string `positional-arg-name:"env-var" description:"Environment variables, at least one of which must be set"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *ensureAtLeastOneCommand) Execute(args []string) error {
+	if !ensureAtLeastOne(c.Positional.EnvVars) {
+		return errCheckFailed
+	}
+	return nil
+}
+
+type waitCommand struct {
+	Positional struct {
+		Address string `positional-arg-name:"address" description:"host:port to connect to"`
+		Timeout string `positional-arg-name:"timeout" description:"Timeout in seconds"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *waitCommand) Execute(args []string) error {
+	if !waitForServer(c.Positional.Address, parseSecondsDuration(c.Positional.Timeout)) {
+		return errCheckFailed
+	}
+	return nil
+}
+
+type httpReadyPlainCommand struct {
+	Positional struct {
+		Url     string `positional-arg-name:"url" description:"URL to poll"`
+		Timeout string `positional-arg-name:"timeout" description:"Timeout in seconds"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *httpReadyPlainCommand) Execute(args []string) error {
+	if !waitForHttp(c.Positional.Url, parseSecondsDuration(c.Positional.Timeout)) {
+		return errCheckFailed
+	}
+	return nil
+}
+
+type pathCommand struct {
+	Positional struct {
+		Path      string `positional-arg-name:"path" description:"Path to check"`
+		Operation string `positional-arg-name:"operation" description:"One of readable, writable, executable, existence"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *pathCommand) Execute(args []string) error {
+	if !path(c.Positional.Path, c.Positional.Operation) {
+		return errCheckFailed
+	}
+	return nil
+}
+
+type pathWaitCommand struct {
+	Positional struct {
+		Path    string `positional-arg-name:"path" description:"Path to wait for"`
+		Timeout string `positional-arg-name:"timeout" description:"Timeout in seconds"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *pathWaitCommand) Execute(args []string) error {
+	if !waitForPath(c.Positional.Path, c.Positional.Timeout) {
+		return errCheckFailed
+	}
+	return nil
+}
+
+type listenersCommand struct {
+	Positional struct {
+		AdvertisedListeners string `positional-arg-name:"advertised-listeners" description:"Value of the advertised.listeners property"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *listenersCommand) Execute(args []string) error {
+	fmt.Println(listenersFromAdvertisedListeners(c.Positional.AdvertisedListeners))
+	return nil
+}
+
+type ensureTopicCommand struct {
+	CreateIfNotExists bool `long:"create-if-not-exists" description:"Create topics if they do not yet exist"`
+	Positional        struct {
+		ConfigFile      string `positional-arg-name:"config-file" description:"Client config used to connect to the cluster"`
+		TopicConfigFile string `positional-arg-name:"topic-config-file" description:"File describing the topics to ensure"`
+		Timeout         string `positional-arg-name:"timeout" description:"Timeout in seconds"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *ensureTopicCommand) Execute(args []string) error {
+	if !ensureTopic(c.Positional.ConfigFile, c.Positional.TopicConfigFile, c.Positional.Timeout, c.CreateIfNotExists) {
+		return errCheckFailed
+	}
+	return nil
+}
+
+type kafkaReadyCommand struct {
+	Bootstrap  string `short:"b" long:"bootstrap-servers" env:"KAFKA_BOOTSTRAP_SERVERS" description:"Bootstrap broker list"`
+	ZooKeeper  string `short:"z" long:"zookeeper-connect" env:"KAFKA_ZOOKEEPER_CONNECT" description:"ZooKeeper connect string"`
+	ConfigFile string `short:"c" long:"config" description:"Path to config properties"`
+	Security   string `short:"s" long:"security-protocol" description:"Security protocol"`
+	Positional struct {
+		MinBrokers string `positional-arg-name:"min-brokers" description:"Minimum number of brokers that must be available"`
+		Timeout    string `positional-arg-name:"timeout" description:"Timeout in seconds"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *kafkaReadyCommand) Execute(args []string) error {
+	if !checkKafkaReady(c.Positional.MinBrokers, c.Positional.Timeout, c.Bootstrap, c.ZooKeeper, c.ConfigFile, c.Security) {
+		return errCheckFailed
+	}
+	return nil
+}
+
+type zkReadyCommand struct {
+	Positional struct {
+		ZookeeperConnect string `positional-arg-name:"zookeeper-connect" description:"ZooKeeper connect string"`
+		Timeout          string `positional-arg-name:"timeout" description:"Timeout in seconds"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *zkReadyCommand) Execute(args []string) error {
+	jvmOpts := ""
+	isZooKeeperSaslEnabled := getEnvOrDefault("ZOOKEEPER_SASL_ENABLED", "")
+	if strings.ToUpper(isZooKeeperSaslEnabled) != "FALSE" {
+		jvmOpts = os.Getenv("KAFKA_OPTS")
+	}
+	javaArgs := [...]string{c.Positional.ZookeeperConnect, c.Positional.Timeout + "000"}
+	if !invokeJavaCommand("io.confluent.admin.utils.cli.ZookeeperReadyCommand", jvmOpts, javaArgs[:]) {
+		return errCheckFailed
+	}
+	return nil
+}
+
+//outputArgs are the --format/--out flags shared by the render-* commands.
+type outputArgs struct {
+	Format string `long:"format" choice:"properties" choice:"json" choice:"yaml" choice:"hocon" choice:"env" default:"properties" description:"Output format"`
+	Out    string `long:"out" description:"Write to this file atomically instead of stdout"`
+}
+
+type renderTemplateCommand struct {
+	outputArgs
+	Positional struct {
+		TemplatePath string `positional-arg-name:"template-path" description:"Path to the template to render"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *renderTemplateCommand) Execute(args []string) error {
+	if c.Format != "" && c.Format != formatProperties {
+		return fmt.Errorf("render-template does not support --format %q: its output is the raw template result", c.Format)
+	}
+	templateFile, err := os.Open(c.Positional.TemplatePath)
+	if err != nil {
+		return err
+	}
+	bytes, err := io.ReadAll(templateFile)
+	if err != nil {
+		return err
+	}
+	funcs := template.FuncMap{
+		"formatHeritage":     formatHeritage,
+		"getEnv":             getEnvOrDefault,
+		"split":              strings.Split,
+		"splitToMapDefaults": splitToMapDefaults,
+	}
+	t, err := template.New("tmpl").Funcs(funcs).Parse(string(bytes))
+	if err != nil {
+		return err
+	}
+	return writeOutput(c.Out, func(w io.Writer) error {
+		renderTemplate(w, *t)
+		return nil
+	})
+}
+
+type renderPropertiesCommand struct {
+	outputArgs
+	Specs []string `long:"spec" required:"yes" description:"Path to a ConfigSpec JSON file; repeat to compose several, later ones override earlier Defaults/Renamed and union Prefixes/Excludes/Types"`
+}
+
+func (c *renderPropertiesCommand) Execute(args []string) error {
+	spec, err := loadConfigSpecs(c.Specs)
+	if err != nil {
+		return err
+	}
+	return writeOutput(c.Out, func(w io.Writer) error {
+		return renderConfig(w, spec, c.Format)
+	})
+}
+
+type validateSpecCommand struct {
+	Specs []string `long:"spec" required:"yes" description:"Path to a ConfigSpec JSON file; repeat to validate the same composition render-properties would use"`
+}
+
+func (c *validateSpecCommand) Execute(args []string) error {
+	spec, err := loadConfigSpecs(c.Specs)
+	if err != nil {
+		return err
+	}
+	if _, err := BuildPropertiesChecked(spec, GetEnvironment()); err != nil {
+		return err
+	}
+	fmt.Println("ConfigSpec is valid")
+	return nil
+}
+
+type renderPropertiesPrefixCommand struct {
+	outputArgs
+	Positional struct {
+		EnvVarPrefix string `positional-arg-name:"env-var-prefix" description:"Environment variable prefix to render as properties"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *renderPropertiesPrefixCommand) Execute(args []string) error {
+	return writeOutput(c.Out, func(w io.Writer) error {
+		return renderConfigViaPrefix(w, c.Positional.EnvVarPrefix, c.Format)
+	})
+}
+
+//templateCommand is kept around only to point users at its replacements; the
+//underlying templating support was removed in favor of render-template et al.
+type templateCommand struct{}
+
+func (c *templateCommand) Execute(args []string) error {
+	fmt.Fprintln(os.Stderr, "templating no longer supported, use 'render-template', 'render-properties', or 'render-properties-prefix' instead")
+	return nil
+}
+
+//completionCommand prints a shell snippet that wires up 'ub's bash/zsh
+//completion hook. The snippet re-runs 'ub' with GO_FLAGS_COMPLETION=1 and the
+//words typed so far as arguments, which is go-flags' own completion protocol,
+//so no subcommand list needs to be kept in sync here.
+type completionCommand struct {
+	Positional struct {
+		Shell string `positional-arg-name:"shell" description:"Shell to generate a completion script for (bash or zsh)"`
+	} `positional-args:"yes"`
+}
+
+const bashCompletionScript = `_ub_completion() {
+    local args=("${COMP_WORDS[@]:1:$COMP_CWORD}")
+    local IFS=$'\n'
+    COMPREPLY=( $(GO_FLAGS_COMPLETION=1 ub "${args[@]}") )
+}
+complete -F _ub_completion ub
+`
+
+const zshCompletionScript = `autoload -U compinit && compinit
+_ub_completion() {
+    local -a reply
+    reply=( ${(f)"$(GO_FLAGS_COMPLETION=1 ub "${(@)words[2,CURRENT]}")"} )
+    compadd -a reply
+}
+compdef _ub_completion ub
+`
+
+func (c *completionCommand) Execute(args []string) error {
+	shell := c.Positional.Shell
+	if shell == "" {
+		shell = "bash"
+	}
+	switch shell {
+	case "bash":
+		fmt.Print(bashCompletionScript)
+	case "zsh":
+		fmt.Print(zshCompletionScript)
+	default:
+		return fmt.Errorf("unsupported shell %q, expected bash or zsh", shell)
+	}
+	return nil
+}
+
+//globalOptions holds the flags parsed before the subcommand name. go-flags
+//populates it while parsing, ie before any subcommand's Execute runs, so
+//debugf (in waiter.go) can read globalOptions.Verbose directly.
+var globalOptions options
+
+func main() {
+	parser := flags.NewParser(&globalOptions, flags.Default)
+	parser.Name = "ub"
+	parser.ShortDescription = "utility belt for Confluent Docker images"
+
+	mustAddCommand(parser, "template", "Deprecated", "Deprecated, see render-template/render-properties/render-properties-prefix.", &templateCommand{})
+	mustAddCommand(parser, "render-template", "Render a Go template", "Renders a Go template (eg a log4j.properties) against the current environment.", &renderTemplateCommand{})
+	mustAddCommand(parser, "render-properties", "Render a ConfigSpec as properties", "Renders the ConfigSpec composed from one or more --spec files as Java properties.", &renderPropertiesCommand{})
+	mustAddCommand(parser, "validate-spec", "Validate a ConfigSpec", "Validates the ConfigSpec composed from one or more --spec files without rendering any output.", &validateSpecCommand{})
+	mustAddCommand(parser, "render-properties-prefix", "Render properties by prefix", "Renders all environment variables with the given prefix as Java properties.", &renderPropertiesPrefixCommand{})
+	mustAddCommand(parser, "ensure", "Ensure an env var is set", "Fails unless the given environment variable is set.", &ensureCommand{})
+	mustAddCommand(parser, "ensure-atleast-one", "Ensure at least one env var is set", "Fails unless at least one of the given environment variables is set.", &ensureAtLeastOneCommand{})
+	mustAddCommand(parser, "wait", "Wait for a TCP server", "Waits until a TCP connection to address succeeds.", &waitCommand{})
+	mustAddCommand(parser, "http-ready", "Wait for an HTTP(S) URL", "Waits until an HTTP(S) GET against url succeeds.", &httpReadyPlainCommand{})
+	mustAddCommand(parser, "path", "Check a filesystem path", "Checks whether path satisfies operation (readable, writable, executable, existence).", &pathCommand{})
+	mustAddCommand(parser, "path-wait", "Wait for a filesystem path", "Waits until path exists.", &pathWaitCommand{})
+	mustAddCommand(parser, "listeners", "Rewrite advertised.listeners", "Rewrites the host part of advertised.listeners entries to 0.0.0.0.", &listenersCommand{})
+	mustAddCommand(parser, "ensure-topic", "Ensure Kafka topics exist", "Ensures the topics described by topic-config-file exist.", &ensureTopicCommand{})
+	mustAddCommand(parser, "kafka-ready", "Wait for a Kafka cluster", "Waits until at least min-brokers Kafka brokers are available.", &kafkaReadyCommand{})
+	mustAddCommand(parser, "zk-ready", "Wait for a ZooKeeper ensemble", "Waits until the given ZooKeeper ensemble is available.", &zkReadyCommand{})
+	mustAddCommand(parser, "sr-ready", "Wait for Schema Registry", "Waits until Schema Registry is available.", &srReadyCommand{})
+	mustAddCommand(parser, "kr-ready", "Wait for REST Proxy", "Waits until the Kafka REST Proxy is available.", &krReadyCommand{})
+	mustAddCommand(parser, "connect-ready", "Wait for Kafka Connect", "Waits until a Kafka Connect worker is available.", &connectReadyCommand{})
+	mustAddCommand(parser, "ksql-server-ready", "Wait for ksqlDB", "Waits until a ksqlDB server is available.", &ksqlServerReadyCommand{})
+	mustAddCommand(parser, "control-center-ready", "Wait for Control Center", "Waits until Confluent Control Center is available.", &controlCenterReadyCommand{})
+	mustAddCommand(parser, "completion", "Print a shell completion script", "Prints a snippet that can be sourced to enable bash/zsh completion for ub.", &completionCommand{})
+	mustAddCommand(parser, "serve", "Run probes on a schedule and expose metrics", "Runs the probes described by --probes on a schedule and exposes them as Prometheus metrics plus /healthz and /readyz, so a single process can back Docker/Kubernetes probes instead of one exec per check.", &serveCommand{})
+
+	if _, err := parser.Parse(); err != nil {
+		//the parser already printed err to stderr (flags.Default includes PrintErrors)
+		var flagsErr *flags.Error
+		if errors.As(err, &flagsErr) && flagsErr.Type == flags.ErrHelp {
+			os.Exit(exitSuccess)
+		}
+		if errors.Is(err, errCheckFailed) {
+			os.Exit(exitCheckFailed)
+		}
+		os.Exit(exitUsageError)
+	}
+}
+
+//mustAddCommand registers cmd under name, panicking on the programmer error
+//of a duplicate or malformed command definition.
+func mustAddCommand(parser *flags.Parser, name string, shortDescription string, longDescription string, cmd interface{}) {
+	if _, err := parser.AddCommand(name, shortDescription, longDescription, cmd); err != nil {
+		panic(err)
+	}
+}
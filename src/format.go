@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//Supported values for the --format flag of render-properties and
+//render-properties-prefix. render-template accepts only formatProperties.
+const (
+	formatProperties = "properties"
+	formatJSON       = "json"
+	formatYAML       = "yaml"
+	formatHOCON      = "hocon"
+	formatEnv        = "env"
+)
+
+//writeConfigAs writes config in the given format. For the nested formats
+//(json, yaml, hocon) dotted keys (eg "listener.name.internal.ssl.keystore.location",
+//as produced by a prefix with keep=false) are grouped into nested maps.
+func writeConfigAs(writer io.Writer, config map[string]string, format string) error {
+	switch format {
+	case "", formatProperties:
+		writeConfig(writer, config)
+		return nil
+	case formatEnv:
+		return writeConfigEnv(writer, config)
+	case formatJSON:
+		data, err := json.MarshalIndent(nestDottedKeys(config), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(writer, string(data))
+		return err
+	case formatYAML:
+		data, err := yaml.Marshal(nestDottedKeys(config))
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(data)
+		return err
+	case formatHOCON:
+		return writeHOCON(writer, nestDottedKeys(config), "")
+	default:
+		return fmt.Errorf("unknown format %q, expected one of properties, json, yaml, hocon, env", format)
+	}
+}
+
+//nestDottedKeys turns a flat {"a.b.c": "v"} map into nested
+//map[string]interface{}{"a": {"b": {"c": "v"}}} maps, splitting keys on '.'.
+//Keys are applied in sorted order so that a conflict between a leaf and a
+//branch at the same path is resolved deterministically (the later, deeper
+//key wins).
+func nestDottedKeys(config map[string]string) map[string]interface{} {
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	root := map[string]interface{}{}
+	for _, name := range names {
+		parts := strings.Split(name, ".")
+		node := root
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				node[part] = config[name]
+				continue
+			}
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+//writeConfigEnv writes config as shell 'export KEY=value' lines, uppercasing
+//property names and replacing both '.' and '-' with '_'. This is not the
+//inverse of ConvertKey: dashes and underscores are not turned back into
+//'___' and '__'.
+func writeConfigEnv(writer io.Writer, config map[string]string) error {
+	if _, err := fmt.Fprintln(writer, formatHeritage()); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	envReplacer := strings.NewReplacer(".", "_", "-", "_")
+	for _, name := range names {
+		envName := strings.ToUpper(envReplacer.Replace(name))
+		if _, err := fmt.Fprintf(writer, "export %s=%s\n", envName, strconv.Quote(config[name])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//writeHOCON writes node as a minimal HOCON document: nested objects become
+//braces, leaves become quoted 'key = value' assignments.
+func writeHOCON(writer io.Writer, node map[string]interface{}, indent string) error {
+	names := make([]string, 0, len(node))
+	for name := range node {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch value := node[name].(type) {
+		case string:
+			if _, err := fmt.Fprintf(writer, "%s%s = %s\n", indent, name, strconv.Quote(value)); err != nil {
+				return err
+			}
+		case map[string]interface{}:
+			if _, err := fmt.Fprintf(writer, "%s%s {\n", indent, name); err != nil {
+				return err
+			}
+			if err := writeHOCON(writer, value, indent+"  "); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(writer, "%s}\n", indent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//writeOutput calls render with either os.Stdout or, if outPath is non-empty,
+//a temp file that is atomically renamed into place on success so a
+//container init never observes a partially-written config.
+func writeOutput(outPath string, render func(io.Writer) error) error {
+	if outPath == "" {
+		return render(os.Stdout)
+	}
+	dir := filepath.Dir(outPath)
+	tmp, err := os.CreateTemp(dir, ".ub-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if err := render(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// os.CreateTemp defaults to mode 0600, but --out is meant to be read by
+	// other containers/sidecars sharing the volume, so match the permissions
+	// a plain stdout redirect would get.
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, outPath)
+}
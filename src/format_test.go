@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNestDottedKeys(t *testing.T) {
+	config := map[string]string{
+		"listener.name.internal.ssl.keystore.location":   "/etc/keystore",
+		"listener.name.internal.ssl.truststore.location": "/etc/truststore",
+		"bootstrap.servers":                              "localhost:9092",
+	}
+
+	nested := nestDottedKeys(config)
+
+	listener, ok := nested["listener"].(map[string]interface{})
+	if !ok {
+		t.Fatal("expected \"listener\" to be nested as a map")
+	}
+	name, ok := listener["name"].(map[string]interface{})
+	if !ok {
+		t.Fatal("expected \"listener.name\" to be nested as a map")
+	}
+	internal, ok := name["internal"].(map[string]interface{})
+	if !ok {
+		t.Fatal("expected \"listener.name.internal\" to be nested as a map")
+	}
+	ssl, ok := internal["ssl"].(map[string]interface{})
+	if !ok {
+		t.Fatal("expected \"listener.name.internal.ssl\" to be nested as a map")
+	}
+	keystore, ok := ssl["keystore"].(map[string]interface{})
+	if !ok {
+		t.Fatal("expected \"...ssl.keystore\" to be nested as a map")
+	}
+	assertEqual(keystore["location"].(string), "/etc/keystore", t)
+
+	if nested["bootstrap"].(map[string]interface{})["servers"] != "localhost:9092" {
+		t.Error("expected a non-nested dotted key to still be split")
+	}
+}
+
+// TestNestDottedKeysLeafBranchCollision documents the "later, deeper key
+// wins" behavior called out in nestDottedKeys' doc comment: when one key is
+// a prefix of another, the result depends on which one sorts last.
+func TestNestDottedKeysLeafBranchCollision(t *testing.T) {
+	branchWins := nestDottedKeys(map[string]string{
+		"a":   "leaf",
+		"a.b": "nested",
+	})
+	expected := map[string]interface{}{
+		"a": map[string]interface{}{"b": "nested"},
+	}
+	if !reflect.DeepEqual(branchWins, expected) {
+		t.Errorf("expected the deeper key \"a.b\" (sorts after \"a\") to win, got %#v", branchWins)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//tlsOptions configures mutual TLS for checkHttp: a client certificate/key pair
+//to present, a CA bundle to verify the server against, and an SNI override.
+type tlsOptions struct {
+	ClientCert string
+	ClientKey  string
+	CACert     string
+	ServerName string
+}
+
+//oauthOptions configures fetching a SASL/OAUTHBEARER-style access token via
+//the OAuth2 client-credentials grant (RFC 6749 section 4.4).
+type oauthOptions struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+}
+
+//httpCheckOptions bundles every knob checkHttp needs, which by now is too
+//many to keep as positional parameters.
+type httpCheckOptions struct {
+	Host        string
+	Port        string
+	Timeout     time.Duration
+	Path        string
+	UseHttps    bool
+	IgnoreCert  bool
+	Username    string
+	Password    string
+	TLS         tlsOptions
+	BearerToken string
+	OAuth       oauthOptions
+	Pred        func(string) bool
+}
+
+//buildTlsConfig builds a tls.Config from opts, loading the CA bundle and
+//client certificate from disk if given.
+func buildTlsConfig(opts tlsOptions, ignoreCert bool) (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: ignoreCert}
+	if opts.ServerName != "" {
+		conf.ServerName = opts.ServerName
+	}
+	if opts.CACert != "" {
+		caBytes, err := os.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("reading --ca-cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no valid certificates found in %s", opts.CACert)
+		}
+		conf.RootCAs = pool
+	}
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading --client-cert/--client-key: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+//oauthTokenCache memoizes access tokens by token URL and client id so that
+//successive readiness checks (and retries within a single Waiter loop) don't
+//hit the token endpoint more than necessary.
+var oauthTokenCache = struct {
+	sync.Mutex
+	tokens map[string]cachedToken
+}{tokens: map[string]cachedToken{}}
+
+type cachedToken struct {
+	value  string
+	expiry time.Time
+}
+
+//fetchOAuthToken obtains an access token via the client-credentials grant,
+//reusing a cached token until shortly before it expires.
+func fetchOAuthToken(tokenURL string, clientID string, clientSecret string) (string, error) {
+	key := tokenURL + "|" + clientID
+
+	oauthTokenCache.Lock()
+	if cached, found := oauthTokenCache.tokens[key]; found && time.Now().Before(cached.expiry) {
+		oauthTokenCache.Unlock()
+		return cached.value, nil
+	}
+	oauthTokenCache.Unlock()
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, clientSecret)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting OAuth token from %s: %w", tokenURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("OAuth token request to %s failed with status %s", tokenURL, resp.Status)
+	}
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", fmt.Errorf("decoding OAuth token response from %s: %w", tokenURL, err)
+	}
+
+	//leave a minute of slack so a token doesn't expire mid-retry
+	expiry := time.Now().Add(time.Duration(tokenResponse.ExpiresIn)*time.Second - time.Minute)
+	oauthTokenCache.Lock()
+	oauthTokenCache.tokens[key] = cachedToken{value: tokenResponse.AccessToken, expiry: expiry}
+	oauthTokenCache.Unlock()
+
+	return tokenResponse.AccessToken, nil
+}
+
+//applyAuth sets the Authorization header on req according to opts,
+//preferring a bearer token (static or OAuth-fetched) over basic auth.
+func applyAuth(req *http.Request, opts httpCheckOptions) error {
+	switch {
+	case opts.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+opts.BearerToken)
+	case opts.OAuth.TokenURL != "":
+		token, err := fetchOAuthToken(opts.OAuth.TokenURL, opts.OAuth.ClientID, opts.OAuth.ClientSecret)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case opts.Username != "" || opts.Password != "":
+		req.SetBasicAuth(opts.Username, opts.Password)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//ProbeSpec describes one probe to run on a schedule, as loaded from the YAML
+//file passed to 'ub serve --probes'. Kind selects which readiness check to
+//run against Target; Options carries the handful of check-specific knobs
+//(eg "secure", "username", "bootstrap-servers") that the one-shot '*-ready'
+//commands expose as flags.
+type ProbeSpec struct {
+	Name     string            `yaml:"name"`
+	Kind     string            `yaml:"kind"`
+	Target   string            `yaml:"target"`
+	Interval time.Duration     `yaml:"interval"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	Options  map[string]string `yaml:"options"`
+}
+
+//loadProbeSpecs reads and validates the probe list at path, filling in
+//reasonable defaults for interval/timeout when they are left unset.
+func loadProbeSpecs(path string) ([]ProbeSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var specs []ProbeSpec
+	if err := yaml.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i := range specs {
+		if specs[i].Name == "" {
+			return nil, fmt.Errorf("probe %d in %s is missing a name", i, path)
+		}
+		if specs[i].Interval == 0 {
+			specs[i].Interval = 30 * time.Second
+		}
+		if specs[i].Timeout == 0 {
+			specs[i].Timeout = 5 * time.Second
+		}
+	}
+	return specs, nil
+}
+
+//runProbe executes spec once and reports whether it succeeded. It dispatches
+//to the same check functions the one-shot '*-ready' subcommands use.
+func runProbe(spec ProbeSpec) bool {
+	switch spec.Kind {
+	case "tcp":
+		return waitForServer(spec.Target, spec.Timeout)
+	case "http":
+		return waitForHttp(spec.Target, spec.Timeout)
+	case "path":
+		return path(spec.Target, "existence")
+	case "sr-ready":
+		return checkHttp(probeHttpOptions(spec, "config", srReadyPred))
+	case "kr-ready":
+		return checkHttp(probeHttpOptions(spec, "topics", nil))
+	case "connect-ready":
+		return checkHttp(probeHttpOptions(spec, "", connectReadyPred))
+	case "ksql-server-ready":
+		return checkHttp(probeHttpOptions(spec, "info", ksqlServerReadyPred))
+	case "control-center-ready":
+		return checkHttp(probeHttpOptions(spec, "", controlCenterReadyPred))
+	case "kafka-ready":
+		return checkKafkaReady(spec.Options["min-brokers"], fmt.Sprintf("%d", int(spec.Timeout.Seconds())),
+			spec.Options["bootstrap-servers"], spec.Options["zookeeper-connect"], spec.Options["config"], spec.Options["security-protocol"])
+	case "zk-ready":
+		jvmOpts := ""
+		if strings.ToUpper(getEnvOrDefault("ZOOKEEPER_SASL_ENABLED", "")) != "FALSE" {
+			jvmOpts = os.Getenv("KAFKA_OPTS")
+		}
+		javaArgs := [...]string{spec.Target, fmt.Sprintf("%d000", int(spec.Timeout.Seconds()))}
+		return invokeJavaCommand("io.confluent.admin.utils.cli.ZookeeperReadyCommand", jvmOpts, javaArgs[:])
+	default:
+		debugf("probe %s: unknown kind %q", spec.Name, spec.Kind)
+		return false
+	}
+}
+
+//probeHttpOptions builds the httpCheckOptions for an HTTP-based probe kind,
+//splitting spec.Target into host/port and reading the "secure",
+//"ignore-cert", "username" and "password" settings from spec.Options. The
+//mTLS, bearer-token and OAuth settings of the '*-ready' commands are not read.
+func probeHttpOptions(spec ProbeSpec, checkPath string, pred func(string) bool) httpCheckOptions {
+	host, port, err := net.SplitHostPort(spec.Target)
+	if err != nil {
+		debugf("probe %s: target %q is not a host:port pair: %s", spec.Name, spec.Target, err)
+	}
+	return httpCheckOptions{
+		Host:       host,
+		Port:       port,
+		Timeout:    spec.Timeout,
+		Path:       checkPath,
+		UseHttps:   spec.Options["secure"] == "true",
+		IgnoreCert: spec.Options["ignore-cert"] == "true",
+		Username:   spec.Options["username"],
+		Password:   spec.Options["password"],
+		Pred:       pred,
+	}
+}
+
+//probeState tracks the most recent outcome of one scheduled probe so that
+///metrics scrapes can be served without re-running the (possibly expensive,
+//JVM-backed) check.
+type probeState struct {
+	spec ProbeSpec
+
+	mu              sync.RWMutex
+	lastSuccess     bool
+	lastLatency     time.Duration
+	lastSuccessTime time.Time
+	hasRun          bool
+}
+
+func (s *probeState) record(success bool, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSuccess = success
+	s.lastLatency = latency
+	s.hasRun = true
+	if success {
+		s.lastSuccessTime = time.Now()
+	}
+}
+
+func (s *probeState) snapshot() (success bool, latency time.Duration, lastSuccessTime time.Time, hasRun bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastSuccess, s.lastLatency, s.lastSuccessTime, s.hasRun
+}
+
+//runLoop runs the probe immediately and then every spec.Interval until stop is closed.
+func (s *probeState) runLoop(stop <-chan struct{}) {
+	s.runOnce()
+	ticker := time.NewTicker(s.spec.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.runOnce()
+		}
+	}
+}
+
+func (s *probeState) runOnce() {
+	start := time.Now()
+	success := runProbe(s.spec)
+	s.record(success, time.Since(start))
+	debugf("probe %s: success=%t latency=%s", s.spec.Name, success, time.Since(start))
+}
+
+//metricsHandler renders the current state of every probe as Prometheus text
+//format gauges.
+func metricsHandler(states []*probeState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		fmt.Fprintln(w, "# HELP ub_probe_success Whether the most recent run of the probe succeeded (1) or failed (0).")
+		fmt.Fprintln(w, "# TYPE ub_probe_success gauge")
+		for _, st := range states {
+			success, _, _, _ := st.snapshot()
+			fmt.Fprintf(w, "ub_probe_success{probe=%q,target=%q} %s\n", st.spec.Name, st.spec.Target, boolToGauge(success))
+		}
+
+		fmt.Fprintln(w, "# HELP ub_probe_latency_seconds Duration of the most recent run of the probe, in seconds.")
+		fmt.Fprintln(w, "# TYPE ub_probe_latency_seconds gauge")
+		for _, st := range states {
+			_, latency, _, _ := st.snapshot()
+			fmt.Fprintf(w, "ub_probe_latency_seconds{probe=%q,target=%q} %f\n", st.spec.Name, st.spec.Target, latency.Seconds())
+		}
+
+		fmt.Fprintln(w, "# HELP ub_probe_last_success_timestamp_seconds Unix timestamp of the last successful run of the probe.")
+		fmt.Fprintln(w, "# TYPE ub_probe_last_success_timestamp_seconds gauge")
+		for _, st := range states {
+			_, _, lastSuccessTime, _ := st.snapshot()
+			var ts float64
+			if !lastSuccessTime.IsZero() {
+				ts = float64(lastSuccessTime.Unix())
+			}
+			fmt.Fprintf(w, "ub_probe_last_success_timestamp_seconds{probe=%q,target=%q} %f\n", st.spec.Name, st.spec.Target, ts)
+		}
+	}
+}
+
+func boolToGauge(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+//healthzHandler reports the process itself is alive, independent of probe outcomes.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+//readyzHandler reports 200 only once every probe has run at least once and
+//its most recent run succeeded, making it suitable as a Kubernetes readiness probe.
+func readyzHandler(states []*probeState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, st := range states {
+			success, _, _, hasRun := st.snapshot()
+			if !hasRun || !success {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintf(w, "probe %s not ready\n", st.spec.Name)
+				return
+			}
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+type serveCommand struct {
+	Listen     string `long:"listen" default:":9102" description:"Address to serve /metrics, /healthz, /readyz on"`
+	ProbesFile string `long:"probes" required:"yes" description:"Path to a YAML file describing the probes to run"`
+}
+
+func (c *serveCommand) Execute(args []string) error {
+	specs, err := loadProbeSpecs(c.ProbesFile)
+	if err != nil {
+		return err
+	}
+	if len(specs) == 0 {
+		return fmt.Errorf("no probes defined in %s", c.ProbesFile)
+	}
+
+	stop := make(chan struct{})
+	states := make([]*probeState, len(specs))
+	for i, spec := range specs {
+		st := &probeState{spec: spec}
+		states[i] = st
+		go st.runLoop(stop)
+	}
+	defer close(stop)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler(states))
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.Handle("/readyz", readyzHandler(states))
+
+	debugf("serving metrics for %d probes on %s", len(states), c.Listen)
+	return http.ListenAndServe(c.Listen, mux)
+}
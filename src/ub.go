@@ -1,9 +1,8 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
-	"flag"
 	"fmt"
 	"io"
 	"net"
@@ -60,25 +59,25 @@ func path(filePath string, operation string) bool {
 	return false
 }
 
-func connectForever(address string, ch chan<- string) {
-	for {
-		_, err := net.Dial("tcp", address)
-		if err == nil {
-			ch <- "success"
-			return
-		}
-	}
+//waitForServer blocks until a TCP connection to address succeeds, retrying
+//with backoff via defaultWaiter, or until timeout elapses.
+func waitForServer(address string, timeout time.Duration) bool {
+	ctx, cancel := signalContext(timeout)
+	defer cancel()
+	return waitForServerCtx(ctx, address)
 }
 
-func waitForServer(address string, timeout time.Duration) bool {
-	c1 := make(chan string, 1)
-	go connectForever(address, c1)
-	select {
-	case <-c1:
+func waitForServerCtx(ctx context.Context, address string) bool {
+	result := defaultWaiter.Wait(ctx, func() bool {
+		conn, err := net.DialTimeout("tcp", address, defaultWaiter.Initial)
+		if err != nil {
+			debugf("dial %s failed: %s", address, err)
+			return false
+		}
+		conn.Close()
 		return true
-	case <-time.After(timeout):
-		return false
-	}
+	})
+	return result.Success
 }
 
 func waitForHttp(urlString string, timeout time.Duration) bool {
@@ -98,19 +97,31 @@ func waitForHttp(urlString string, timeout time.Duration) bool {
 		}
 		server = net.JoinHostPort(u.Host, port)
 	}
-	if !waitForServer(server, timeout) {
-		return false
-	}
-	resp, err := http.Get(urlString)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error retrieving url")
-		return false
-	}
-	if resp.StatusCode/100 != 2 {
-		fmt.Fprintln(os.Stderr, resp.Status)
+	ctx, cancel := signalContext(timeout)
+	defer cancel()
+	if !waitForServerCtx(ctx, server) {
 		return false
 	}
-	return true
+	client := &http.Client{Timeout: perAttemptTimeout(timeout)}
+	result := defaultWaiter.Wait(ctx, func() bool {
+		req, err := http.NewRequestWithContext(ctx, "GET", urlString, nil)
+		if err != nil {
+			debugf("building request for %s failed: %s", urlString, err)
+			return false
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			debugf("GET %s failed: %s", urlString, err)
+			return false
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			debugf("GET %s returned %s", urlString, resp.Status)
+			return false
+		}
+		return true
+	})
+	return result.Success
 }
 
 func parseSecondsDuration(s string) time.Duration {
@@ -125,20 +136,28 @@ func renderTemplate(writer io.Writer, template template.Template) {
 	template.Execute(writer, GetEnvironment())
 }
 
-func renderConfig(writer io.Writer, configSpec ConfigSpec) {
-	writeConfig(writer, BuildProperties(configSpec, GetEnvironment()))
+func renderConfig(writer io.Writer, configSpec ConfigSpec, format string) error {
+	config, err := BuildPropertiesChecked(configSpec, GetEnvironment())
+	if err != nil {
+		return err
+	}
+	return writeConfigAs(writer, config, format)
 }
 
-func renderConfigViaPrefix(writer io.Writer, envVarPrefix string) {
+func renderConfigViaPrefix(writer io.Writer, envVarPrefix string, format string) error {
 	// used, eg, for schema registry  and all admin-properties
 	spec := ConfigSpec{
 		Prefixes: map[string]bool{envVarPrefix: false},
 		Excludes: []string{},
 		Renamed:  map[string]string{},
 		Defaults: map[string]string{},
+		Types:    map[string]string{},
+	}
+	config, err := BuildPropertiesChecked(spec, GetEnvironment())
+	if err != nil {
+		return err
 	}
-	config := BuildProperties(spec, GetEnvironment())
-	writeConfig(writer, config)
+	return writeConfigAs(writer, config, format)
 }
 
 // ConvertKey Converts an environment variable name to a property-name according to the following rules:
@@ -164,6 +183,103 @@ type ConfigSpec struct {
 	Excludes []string          `json:"excludes"`
 	Renamed  map[string]string `json:"renamed"`
 	Defaults map[string]string `json:"defaults"`
+	//Types maps a produced property key to a type hint ("csv", "int" or
+	//"bool") that BuildPropertiesChecked uses to normalize and validate its value.
+	Types map[string]string `json:"types"`
+}
+
+//knownTypeHints are the type hints recognized in ConfigSpec.Types.
+var knownTypeHints = map[string]bool{"csv": true, "int": true, "bool": true}
+
+//Validate checks invariants that BuildProperties can't enforce on its own:
+//that no two renamed env vars target the same property key, that a renamed
+//target doesn't collide with a kept prefix of the same name, that excluded
+//entries look like environment variable names, and that every type hint is
+//one this tool understands.
+func (spec ConfigSpec) Validate() error {
+	var problems []string
+
+	envVarPattern := regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	for _, excluded := range spec.Excludes {
+		if !envVarPattern.MatchString(excluded) {
+			problems = append(problems, fmt.Sprintf("excluded entry %q does not look like an environment variable name", excluded))
+		}
+	}
+
+	targets := make(map[string][]string)
+	for envKey, target := range spec.Renamed {
+		targets[target] = append(targets[target], envKey)
+	}
+	for target, envKeys := range targets {
+		sort.Strings(envKeys)
+		if len(envKeys) > 1 {
+			problems = append(problems, fmt.Sprintf("rename target %q is claimed by multiple environment variables: %s", target, strings.Join(envKeys, ", ")))
+		}
+		for prefix, keep := range spec.Prefixes {
+			if keep && strings.HasPrefix(target, ConvertKey(prefix)) {
+				problems = append(problems, fmt.Sprintf("rename target %q (from %s) collides with kept prefix %q, which would also pass environment variables through under that name", target, strings.Join(envKeys, ", "), prefix))
+			}
+		}
+	}
+
+	for key, hint := range spec.Types {
+		if !knownTypeHints[hint] {
+			problems = append(problems, fmt.Sprintf("key %q has unknown type hint %q, expected csv, int or bool", key, hint))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid ConfigSpec:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+//mergeConfigSpecs composes specs in order: Prefixes, Excludes and Types are
+//unioned, while Defaults and Renamed entries from later specs override
+//entries of the same key from earlier ones.
+func mergeConfigSpecs(specs []ConfigSpec) ConfigSpec {
+	merged := ConfigSpec{
+		Prefixes: map[string]bool{},
+		Excludes: []string{},
+		Renamed:  map[string]string{},
+		Defaults: map[string]string{},
+		Types:    map[string]string{},
+	}
+	for _, spec := range specs {
+		for prefix, keep := range spec.Prefixes {
+			merged.Prefixes[prefix] = keep
+		}
+		for _, excluded := range spec.Excludes {
+			if !Contains(merged.Excludes, excluded) {
+				merged.Excludes = append(merged.Excludes, excluded)
+			}
+		}
+		for envKey, target := range spec.Renamed {
+			merged.Renamed[envKey] = target
+		}
+		for key, value := range spec.Defaults {
+			merged.Defaults[key] = value
+		}
+		for key, hint := range spec.Types {
+			merged.Types[key] = hint
+		}
+	}
+	return merged
+}
+
+//loadConfigSpecs loads and merges the ConfigSpec at each of paths, in order;
+//see mergeConfigSpecs for the merge rules.
+func loadConfigSpecs(paths []string) (ConfigSpec, error) {
+	specs := make([]ConfigSpec, 0, len(paths))
+	for _, path := range paths {
+		spec, err := loadConfigSpec(path)
+		if err != nil {
+			return ConfigSpec{}, err
+		}
+		specs = append(specs, spec)
+	}
+	return mergeConfigSpecs(specs), nil
 }
 
 //Contains returns true if slice contains element, and false otherwise.
@@ -232,6 +348,50 @@ func BuildProperties(spec ConfigSpec, environment map[string]string) map[string]
 	return config
 }
 
+//BuildPropertiesChecked is like BuildProperties, but first validates spec and
+//then normalizes/validates every property that has a type hint in
+//spec.Types, rejecting the whole result with an actionable error instead of
+//emitting a malformed value into the properties file.
+func BuildPropertiesChecked(spec ConfigSpec, environment map[string]string) (map[string]string, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	config := BuildProperties(spec, environment)
+	if err := applyTypeHints(spec, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+//applyTypeHints normalizes (and validates) config in place according to spec.Types.
+func applyTypeHints(spec ConfigSpec, config map[string]string) error {
+	for key, hint := range spec.Types {
+		value, found := config[key]
+		if !found {
+			continue
+		}
+		switch hint {
+		case "csv":
+			parts := strings.Split(value, ",")
+			for i, part := range parts {
+				parts[i] = strings.TrimSpace(part)
+			}
+			config[key] = strings.Join(parts, ",")
+		case "int":
+			if _, err := strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return fmt.Errorf("property %q has type hint \"int\" but value %q is not an integer: %w", key, value, err)
+			}
+		case "bool":
+			if _, err := strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+				return fmt.Errorf("property %q has type hint \"bool\" but value %q is not a boolean: %w", key, value, err)
+			}
+		default:
+			return fmt.Errorf("property %q has unknown type hint %q", key, hint)
+		}
+	}
+	return nil
+}
+
 func formatHeritage() string {
 	return "# created by 'ub' from environment variables on " + time.Now().String()
 }
@@ -260,91 +420,81 @@ func listenersFromAdvertisedListeners(listeners string) string {
 	return re.ReplaceAllString(listeners, "://0.0.0.0:")
 }
 
-func loadConfigSpec(path string) ConfigSpec {
+func loadConfigSpec(path string) (ConfigSpec, error) {
 	jsonFile, err := os.Open(path)
 	if err != nil {
-		panic(err)
+		return ConfigSpec{}, fmt.Errorf("could not open ConfigSpec %q: %w", path, err)
 	}
+	defer jsonFile.Close()
 	bytes, err := io.ReadAll(jsonFile)
 	if err != nil {
-		panic(err)
+		return ConfigSpec{}, fmt.Errorf("could not read ConfigSpec %q: %w", path, err)
 	}
 
 	var spec ConfigSpec
-
-	errParse := json.Unmarshal(bytes, &spec)
-	if errParse != nil {
-		panic(errParse)
+	if err := json.Unmarshal(bytes, &spec); err != nil {
+		return ConfigSpec{}, fmt.Errorf("could not parse ConfigSpec %q: %w", path, err)
 	}
-	return spec
+	return spec, nil
 }
 
-/*
-TOOD: add remark about how flags work in golang
-*/
-func checkHttp(host string, port string, timeout time.Duration, path string, useHttps bool, ignoreCert bool, username string, password string, pred func(string) bool) bool {
-	address := host + ":" + port
-	if !waitForServer(host+":"+port, timeout) {
-		fmt.Fprintf(os.Stderr, "Could not reach address %s in %s", address, timeout.String())
+func checkHttp(opts httpCheckOptions) bool {
+	address := opts.Host + ":" + opts.Port
+	ctx, cancel := signalContext(opts.Timeout)
+	defer cancel()
+	if !waitForServerCtx(ctx, address) {
+		fmt.Fprintf(os.Stderr, "Could not reach address %s in %s", address, opts.Timeout.String())
 		return false
 	}
-	tlsConf := &tls.Config{
-		InsecureSkipVerify: ignoreCert,
+	tlsConf, err := buildTlsConfig(opts.TLS, opts.IgnoreCert)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid TLS configuration: %s", err)
+		return false
 	}
 	tr := &http.Transport{TLSClientConfig: tlsConf}
-	client := &http.Client{Transport: tr, Timeout: timeout}
+	client := &http.Client{Transport: tr, Timeout: perAttemptTimeout(opts.Timeout)}
 	url := ""
-	if useHttps {
-		url = "https://" + host + ":" + port
+	if opts.UseHttps {
+		url = "https://" + address
 	} else {
-		url = "http://" + host + ":" + port
+		url = "http://" + address
 	}
-	if path != "" {
-		url = url + "/" + path
+	if opts.Path != "" {
+		url = url + "/" + opts.Path
 	}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		panic(err)
 	}
-	if username != "" || password != "" {
-		req.SetBasicAuth(username, password)
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error performing request to %s", url)
-		return false
-	}
-	if resp.StatusCode/100 != 2 {
-		fmt.Fprintf(os.Stderr, "Failed to perform, %d", resp.StatusCode)
-		return false
-	}
-	if pred != nil {
+	result := defaultWaiter.Wait(ctx, func() bool {
+		if err := applyAuth(req, opts); err != nil {
+			debugf("failed to authenticate request to %s: %s", url, err)
+			return false
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			debugf("request to %s failed: %s", url, err)
+			return false
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			debugf("request to %s returned %d", url, resp.StatusCode)
+			return false
+		}
+		if opts.Pred == nil {
+			return true
+		}
 		bodyText, err := io.ReadAll(resp.Body)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error reading response")
+			debugf("error reading response body from %s: %s", url, err)
 			return false
 		}
-		return pred(string(bodyText))
-	}
-	return true
-}
-
-func performHttpCheck(path string, pred func(string) bool) bool {
-	httpReadyCmd := flag.NewFlagSet("sr-ready", flag.ExitOnError)
-	httpReadySecure := httpReadyCmd.Bool("secure", false, "Use TLS to secure the connection")
-	httpReadyIngnoreCert := httpReadyCmd.Bool("ignore_cert", false, "Ignore TLS certificate errors")
-	httpReadyUserName := httpReadyCmd.String("username", "", "Username used to authenticate to the Schema Registry")
-	httpReadyPassword := httpReadyCmd.String("password", "", "Password used to authenticate to the Schema Registry")
-
-	httpReadyCmd.Parse(os.Args[2:])
-	if httpReadyCmd.NArg() != 3 {
-		fmt.Fprint(os.Stderr, "Missing positional argument: ")
-		fmt.Fprintln(os.Stderr, httpReadyCmd.Args())
-		return false
-	} else {
-		return checkHttp(httpReadyCmd.Arg(0), httpReadyCmd.Arg(1), parseSecondsDuration(httpReadyCmd.Arg(2)), path, *httpReadySecure, *httpReadyIngnoreCert, *httpReadyUserName, *httpReadyPassword,
-			pred)
+		return opts.Pred(string(bodyText))
+	})
+	if !result.Success {
+		fmt.Fprintf(os.Stderr, "Failed to reach %s after %d attempts in %s", url, result.Attempts, result.Elapsed)
 	}
+	return result.Success
 }
 
 func invokeJavaCommand(className string, jvmOpts string, args []string) bool {
@@ -408,145 +558,19 @@ func ensureTopic(configFile string, topicConfigFile string, timeout string, crea
 	)
 }
 
-func waitForPathForever(pathToWaitFor string, ch chan<- string) {
-	for {
-		if path(pathToWaitFor, "existence") {
-			ch <- "success"
-		}
-		time.Sleep(time.Second)
-	}
-}
-
-func waitForPath(path string, timeoutSeconds string) bool {
+func waitForPath(pathToWaitFor string, timeoutSeconds string) bool {
 	//TODO: refactor to use parseSecondsDuration instead of passing in a string
 	timeout, err := time.ParseDuration(timeoutSeconds + "s")
 	if err != nil {
 		panic(err)
 	}
-	c1 := make(chan string, 1)
-	go waitForPathForever(path, c1)
-	select {
-	case <-c1:
-		return true
-	case <-time.After(timeout):
-		return false
-	}
-}
-
-func checkAndPrintUsage(numArguments int, message string) {
-	if len(os.Args) != numArguments {
-		fmt.Fprintf(os.Stderr, "Usage '%s %s %s", os.Args[0], os.Args[1], message)
-		os.Exit(1)
-	}
+	ctx, cancel := signalContext(timeout)
+	defer cancel()
+	result := defaultWaiter.Wait(ctx, func() bool {
+		return path(pathToWaitFor, "existence")
+	})
+	return result.Success
 }
 
-func main() {
-	success := false
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage '%s <subcommand> ...'", os.Args[0])
-		os.Exit(1)
-	}
-	switch os.Args[1] {
-	//commands from the 'dub' tool
-	case "template":
-		fmt.Fprintln(os.Stderr, "templating no longer supported, use 'render-template', 'render-properties', or 'render-properties-prefix' instead")
-		os.Exit(2)
-	case "render-template":
-		// render a template (used for log4j properties)
-		checkAndPrintUsage(3, "<path-to-template>")
-		templateFile, err := os.Open(os.Args[2])
-		if err != nil {
-			panic(err) // TODO: write to stderr instead of break
-		}
-		bytes, err := io.ReadAll(templateFile)
-		if err != nil {
-			panic(err)
-		}
-		funcs := template.FuncMap{
-			"formatHeritage":     formatHeritage,
-			"getEnv":             getEnvOrDefault,
-			"split":              strings.Split,
-			"splitToMapDefaults": splitToMapDefaults,
-		}
-		t := template.Must(template.New("tmpl").Funcs(funcs).Parse(string(bytes)))
-		renderTemplate(os.Stdout, *t)
-		success = true
-	case "render-properties":
-		checkAndPrintUsage(3, "<path-to-config-spec>")
-		configSpec := loadConfigSpec(os.Args[2])
-		renderConfig(os.Stdout, configSpec)
-		success = true
-	case "render-properties-prefix":
-		checkAndPrintUsage(3, "<env-var-prefix>")
-		renderConfigViaPrefix(os.Stdout, os.Args[2])
-		success = true
-	case "ensure":
-		success = ensure(os.Args[2])
-	case "ensure-atleast-one":
-		success = ensureAtLeastOne(os.Args[2:])
-	case "wait":
-		success = waitForServer(os.Args[2], parseSecondsDuration(os.Args[3]))
-	case "http-ready":
-		success = waitForHttp(os.Args[2], parseSecondsDuration(os.Args[3]))
-	case "path":
-		success = path(os.Args[2], os.Args[3])
-	case "path-wait":
-		success = waitForPath(os.Args[2], os.Args[3])
-
-	case "listeners":
-		println(listenersFromAdvertisedListeners(os.Args[2]))
-		success = true
-	case "ensure-topic":
-		ensureTopicCmd := flag.NewFlagSet("ensure-topic", flag.ExitOnError)
-		ensureTopicCreate := ensureTopicCmd.Bool("create_if_not_exists", false, "Create topics if they do not yet exist.")
-		ensureTopicCmd.Parse(os.Args[2:])
-		if ensureTopicCmd.NArg() != 3 {
-			fmt.Fprintln(os.Stderr, "Missing positional argument", ensureTopicCmd.Args())
-		} else {
-			success = ensureTopic(ensureTopicCmd.Arg(0), ensureTopicCmd.Arg(1), ensureTopicCmd.Arg(2), *ensureTopicCreate)
-		}
-	case "kafka-ready":
-		//first positional argument: number brokers
-		//second positional argument: timeout in seconds
-		kafkaReadyCmd := flag.NewFlagSet("kafka-ready", flag.ExitOnError)
-		kafkaReadyBootstrap := kafkaReadyCmd.String("b", "", "Bootstrap broker list")
-		kafkaReadyZooKeeper := kafkaReadyCmd.String("z", "", "ZooKeeper connect string")
-		kafkaReadyConfig := kafkaReadyCmd.String("c", "", "Path to config properties")
-		kafkaReadySecurity := kafkaReadyCmd.String("s", "", "Security protocol")
-
-		kafkaReadyCmd.Parse(os.Args[2:])
-		if kafkaReadyCmd.NArg() != 2 {
-			fmt.Fprintln(os.Stderr, "Missing positional argument", kafkaReadyCmd.Args())
-		} else {
-			success = checkKafkaReady(kafkaReadyCmd.Arg(0), kafkaReadyCmd.Arg(1), *kafkaReadyBootstrap, *kafkaReadyZooKeeper, *kafkaReadyConfig, *kafkaReadySecurity)
-		}
-	case "zk-ready":
-		checkAndPrintUsage(4, "<zookeeper-connect> <timeout-in-seconds>")
-
-		jvmOpts := ""
-		isZooKeeperSaslEnabled := getEnvOrDefault("ZOOKEEPER_SASL_ENABLED", "")
-		if strings.ToUpper(isZooKeeperSaslEnabled) != "FALSE" {
-			jvmOpts = os.Getenv("KAFKA_OPTS")
-		}
-		args := [...]string{os.Args[2], os.Args[3] + "000"}
-
-		success = invokeJavaCommand("io.confluent.admin.utils.cli.ZookeeperReadyCommand", jvmOpts, args[:])
-
-	case "sr-ready":
-		success = performHttpCheck("config", func(s string) bool { return strings.Contains(s, "compatibilityLevel") })
-	case "kr-ready":
-		success = performHttpCheck("topics", nil)
-	case "connect-ready":
-		success = performHttpCheck("", func(s string) bool { return strings.Contains(s, "version") })
-	case "ksql-server-ready":
-		success = performHttpCheck("info", func(s string) bool { return strings.Contains(s, "Ksql") })
-	case "control-center-ready":
-		success = performHttpCheck("", func(s string) bool { return strings.Contains(s, "Control Center") })
-	default:
-		fmt.Fprintln(os.Stderr, "Unknown subcommand "+os.Args[1])
-	}
-
-	if !success {
-		os.Exit(1)
-	}
-}
+//main is defined in cli.go, which wires the subcommands declared there into
+//a jessevdk/go-flags command tree.
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func assertEqual(a string, b string, t *testing.T) {
+	if a != b {
+		t.Error(a + " != " + b)
+	}
+}
+
+func TestContains(t *testing.T) {
+	if Contains([]string{"hello", "world"}, "hi") {
+		t.Error(` Contains([]string{"hello", "world"}, "hi") = true`)
+	}
+	if !Contains([]string{"hello", "world"}, "hello") {
+		t.Error(`Contains([]string{"hello", "world"}, "hello") = false`)
+	}
+}
+
+func TestConvertKey(t *testing.T) {
+	assertEqual(ConvertKey("KEY"), "key", t)
+	assertEqual(ConvertKey("KEY_FOO"), "key.foo", t)
+	assertEqual(ConvertKey("KEY__UNDERSCORE"), "key_underscore", t)
+	assertEqual(ConvertKey("KEY_WITH__UNDERSCORE_AND__MORE"), "key.with_underscore.and_more", t)
+	assertEqual(ConvertKey("KEY___DASH"), "key-dash", t)
+	assertEqual(ConvertKey("KEY_WITH___DASH_AND___MORE__UNDERSCORE"), "key.with-dash.and-more_underscore", t)
+}
+
+func TestBuildProperties(t *testing.T) {
+	var testEnv = map[string]string{
+		"PATH":                    "thePath",
+		"KAFKA_BOOTSTRAP_SERVERS": "localhost:9092",
+		"CONFLUENT_METRICS":       "metricsValue",
+		"KAFKA_IGNORED":           "ignored",
+	}
+
+	var onlyDefaultsCS = ConfigSpec{
+		Prefixes: map[string]bool{},
+		Excludes: []string{},
+		Renamed:  map[string]string{},
+		Defaults: map[string]string{
+			"default.property.key": "default.property.value",
+			"bootstrap.servers":    "unknown",
+		},
+	}
+
+	var onlyDefaults = BuildProperties(onlyDefaultsCS, testEnv)
+	fmt.Println(onlyDefaults)
+	if len(onlyDefaults) != 2 {
+		t.Error("Failed to parse defaults.")
+	}
+	if onlyDefaults["default.property.key"] != "default.property.value" {
+		t.Error("default.property.key not parsed correctly")
+	}
+
+	var serverCS = ConfigSpec{
+		Prefixes: map[string]bool{"KAFKA": false, "CONFLUENT": true},
+		Excludes: []string{"KAFKA_IGNORED"},
+		Renamed:  map[string]string{},
+		Defaults: map[string]string{
+			"default.property.key": "default.property.value",
+			"bootstrap.servers":    "unknown",
+		},
+	}
+	var serverProps = BuildProperties(serverCS, testEnv)
+	if len(serverProps) != 3 {
+		t.Error("Server props size != 3")
+	}
+	if serverProps["bootstrap.servers"] != "localhost:9092" {
+		t.Error("Dropped prefixed not parsed correctly")
+	}
+	if serverProps["confluent.metrics"] != "metricsValue" {
+		t.Error("Kept prefix not parsed correctly")
+	}
+
+	var kafkaEnv = map[string]string{
+		"KAFKA_FOO":                       "foo",
+		"KAFKA_FOO_BAR":                   "bar",
+		"KAFKA_IGNORED":                   "ignored",
+		"KAFKA_WITH__UNDERSCORE":          "with underscore",
+		"KAFKA_WITH__UNDERSCORE_AND_MORE": "with underscore and more",
+		"KAFKA_WITH___DASH":               "with dash",
+		"KAFKA_WITH___DASH_AND_MORE":      "with dash and more",
+	}
+
+	var kafkaProperties = BuildProperties(serverCS, kafkaEnv)
+
+	if len(kafkaProperties) != 8 {
+		t.Error("Wrong number of properties")
+	}
+	assertEqual(kafkaProperties["foo"], "foo", t)
+	assertEqual(kafkaProperties["foo.bar"], "bar", t)
+	assertEqual(kafkaProperties["with_underscore"], "with underscore", t)
+	assertEqual(kafkaProperties["with_underscore.and.more"], "with underscore and more", t)
+	assertEqual(kafkaProperties["with-dash"], "with dash", t)
+	assertEqual(kafkaProperties["with-dash.and.more"], "with dash and more", t)
+}
+
+func TestConfigSpecValidate(t *testing.T) {
+	var valid = ConfigSpec{
+		Prefixes: map[string]bool{"KAFKA": false},
+		Excludes: []string{"KAFKA_IGNORED"},
+		Renamed:  map[string]string{"KAFKA_BOOTSTRAP_SERVERS": "bootstrap.servers"},
+		Defaults: map[string]string{},
+		Types:    map[string]string{"listeners": "csv", "retries": "int"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Error("expected valid ConfigSpec to pass validation, got", err)
+	}
+
+	var badExclude = ConfigSpec{Excludes: []string{"not an env var"}}
+	if err := badExclude.Validate(); err == nil {
+		t.Error("expected excluded entry with spaces to fail validation")
+	}
+
+	var clashingRename = ConfigSpec{
+		Renamed: map[string]string{
+			"KAFKA_BOOTSTRAP_SERVERS": "bootstrap.servers",
+			"BROKERS":                 "bootstrap.servers",
+		},
+	}
+	if err := clashingRename.Validate(); err == nil {
+		t.Error("expected two env vars renamed to the same target to fail validation")
+	}
+
+	var unknownType = ConfigSpec{Types: map[string]string{"retries": "number"}}
+	if err := unknownType.Validate(); err == nil {
+		t.Error("expected unknown type hint to fail validation")
+	}
+
+	var clashingPrefix = ConfigSpec{
+		Prefixes: map[string]bool{"CONFLUENT": true},
+		Renamed:  map[string]string{"SOME_VAR": "confluent.metrics"},
+	}
+	if err := clashingPrefix.Validate(); err == nil {
+		t.Error("expected rename target to fail validation when it collides with a kept prefix")
+	}
+}
+
+func TestMergeConfigSpecs(t *testing.T) {
+	var base = ConfigSpec{
+		Prefixes: map[string]bool{"KAFKA": false},
+		Excludes: []string{"KAFKA_IGNORED"},
+		Renamed:  map[string]string{},
+		Defaults: map[string]string{"bootstrap.servers": "base-value"},
+		Types:    map[string]string{"retries": "int"},
+	}
+	var overlay = ConfigSpec{
+		Prefixes: map[string]bool{"CONFLUENT": true},
+		Excludes: []string{"CONFLUENT_IGNORED"},
+		Renamed:  map[string]string{},
+		Defaults: map[string]string{"bootstrap.servers": "overlay-value"},
+		Types:    map[string]string{"listeners": "csv"},
+	}
+
+	merged := mergeConfigSpecs([]ConfigSpec{base, overlay})
+
+	assertEqual(merged.Defaults["bootstrap.servers"], "overlay-value", t)
+	if _, ok := merged.Prefixes["KAFKA"]; !ok {
+		t.Error("expected prefixes from both specs to be present")
+	}
+	if _, ok := merged.Prefixes["CONFLUENT"]; !ok {
+		t.Error("expected prefixes from both specs to be present")
+	}
+	if !Contains(merged.Excludes, "KAFKA_IGNORED") || !Contains(merged.Excludes, "CONFLUENT_IGNORED") {
+		t.Error("expected excludes from both specs to be present")
+	}
+	assertEqual(merged.Types["retries"], "int", t)
+	assertEqual(merged.Types["listeners"], "csv", t)
+}
+
+func TestBuildPropertiesCheckedTypes(t *testing.T) {
+	var spec = ConfigSpec{
+		Prefixes: map[string]bool{},
+		Excludes: []string{},
+		Renamed:  map[string]string{},
+		Defaults: map[string]string{
+			"listeners": " PLAINTEXT://a:9092 , PLAINTEXT://b:9092 ",
+			"retries":   "3",
+		},
+		Types: map[string]string{"listeners": "csv", "retries": "int"},
+	}
+
+	config, err := BuildPropertiesChecked(spec, map[string]string{})
+	if err != nil {
+		t.Error("expected valid types to pass, got", err)
+	}
+	assertEqual(config["listeners"], "PLAINTEXT://a:9092,PLAINTEXT://b:9092", t)
+
+	var badSpec = ConfigSpec{
+		Defaults: map[string]string{"retries": "not-a-number"},
+		Types:    map[string]string{"retries": "int"},
+	}
+	if _, err := BuildPropertiesChecked(badSpec, map[string]string{}); err == nil {
+		t.Error("expected non-integer value for an \"int\" type hint to fail")
+	}
+}
+
+func TestDecorrelatedJitter(t *testing.T) {
+	base := 200 * time.Millisecond
+	max := 5 * time.Second
+	factor := 3.0
+
+	prev := base
+	for i := 0; i < 100; i++ {
+		next := decorrelatedJitter(prev, base, max, factor)
+		if next < base {
+			t.Fatalf("interval %s is below base %s", next, base)
+		}
+		if next > max {
+			t.Fatalf("interval %s exceeds max %s", next, max)
+		}
+		prev = next
+	}
+}
+
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+//Waiter retries a check with decorrelated-jitter exponential backoff until it
+//succeeds or its context is done. It replaces the tight net.Dial/stat loops
+//that used to busy-wait while polling dependencies during container startup.
+type Waiter struct {
+	Initial time.Duration
+	Max     time.Duration
+	Factor  float64
+}
+
+//defaultWaiter is used by the wait* helpers and checkHttp in ub.go.
+var defaultWaiter = Waiter{
+	Initial: 200 * time.Millisecond,
+	Max:     5 * time.Second,
+	Factor:  3,
+}
+
+//WaitResult reports how a Waiter.Wait call ended, so callers can log
+//diagnostics about which dependency was slow.
+type WaitResult struct {
+	Success  bool
+	Attempts int
+	Elapsed  time.Duration
+}
+
+//Wait calls check repeatedly until it returns true or ctx is done, sleeping
+//between attempts for a decorrelated-jitter interval bounded by w.Max.
+func (w Waiter) Wait(ctx context.Context, check func() bool) WaitResult {
+	start := time.Now()
+	attempts := 0
+	interval := w.Initial
+	for {
+		attempts++
+		if check() {
+			return WaitResult{Success: true, Attempts: attempts, Elapsed: time.Since(start)}
+		}
+		select {
+		case <-ctx.Done():
+			return WaitResult{Success: false, Attempts: attempts, Elapsed: time.Since(start)}
+		default:
+		}
+		interval = decorrelatedJitter(interval, w.Initial, w.Max, w.Factor)
+		debugf("attempt %d failed, retrying in %s", attempts, interval)
+		select {
+		case <-ctx.Done():
+			return WaitResult{Success: false, Attempts: attempts, Elapsed: time.Since(start)}
+		case <-time.After(interval):
+		}
+	}
+}
+
+//decorrelatedJitter implements the "decorrelated jitter" backoff from
+//https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/:
+//the next interval is a random value between base and factor*prev, capped at max.
+func decorrelatedJitter(prev time.Duration, base time.Duration, max time.Duration, factor float64) time.Duration {
+	upper := time.Duration(float64(prev) * factor)
+	if upper < base {
+		upper = base
+	}
+	if upper > max {
+		upper = max
+	}
+	if upper <= base {
+		return base
+	}
+	return base + time.Duration(rand.Int63n(int64(upper-base)))
+}
+
+//perAttemptTimeout bounds a single HTTP attempt to a fraction of the overall
+//timeout, so that a server that accepts the TCP connection but never answers
+//the HTTP request can't consume the whole budget on its first attempt and
+//starve Wait's retry/backoff loop.
+func perAttemptTimeout(overall time.Duration) time.Duration {
+	t := overall / 4
+	if t > defaultWaiter.Max {
+		t = defaultWaiter.Max
+	}
+	if t < defaultWaiter.Initial {
+		t = defaultWaiter.Initial
+	}
+	return t
+}
+
+//signalContext returns a context that is cancelled after timeout or when the
+//process receives SIGINT/SIGTERM, whichever comes first.
+func signalContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancelTimeout := context.WithTimeout(context.Background(), timeout)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	return ctx, func() {
+		stop()
+		cancelTimeout()
+	}
+}
+
+//debugf logs a diagnostic message to stderr when verbose logging was
+//requested via 'ub -v ...', both for one-shot commands and for 'ub serve'.
+//It writes plain lines with no timestamps or levels.
+func debugf(format string, args ...interface{}) {
+	if globalOptions.Verbose {
+		fmt.Fprintf(os.Stderr, "DEBUG: "+format+"\n", args...)
+	}
+}